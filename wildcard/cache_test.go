@@ -0,0 +1,92 @@
+/*-
+ * Copyright 2018 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wildcard
+
+import "testing"
+
+func TestMatcherSetCacheHitsAndMisses(t *testing.T) {
+	set, err := NewMatcherSet([]string{"spiffe://prod/db/**"}, WithCache(16))
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	if _, ok := set.Match("spiffe://prod/db/instance1"); !ok {
+		t.Fatalf("expected match")
+	}
+	if _, ok := set.Match("spiffe://prod/db/instance1"); !ok {
+		t.Fatalf("expected cached match")
+	}
+
+	stats := set.Stats()
+	if stats.Misses != 1 || stats.Hits != 1 {
+		t.Fatalf("expected 1 miss and 1 hit, got %+v", stats)
+	}
+}
+
+func TestMatcherSetCacheInvalidatedOnRebuild(t *testing.T) {
+	set, err := NewMatcherSet([]string{"spiffe://prod/db/**"}, WithCache(16))
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	uri := "spiffe://prod/db/instance1"
+	if _, ok := set.Match(uri); !ok {
+		t.Fatalf("expected match before rebuild")
+	}
+
+	// Rebuilding with a disjoint pattern set must invalidate the cache: a
+	// stale cached "match" for uri must not survive the rebuild.
+	if err := set.Rebuild([]string{"spiffe://prod/web/**"}); err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+
+	if _, ok := set.Match(uri); ok {
+		t.Fatalf("expected no match after rebuild invalidated the cache")
+	}
+}
+
+func TestMatcherSetNoCacheByDefault(t *testing.T) {
+	set, err := NewMatcherSet([]string{"spiffe://prod/db/**"})
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	if _, ok := set.Match("spiffe://prod/db/instance1"); !ok {
+		t.Fatalf("expected match")
+	}
+
+	if stats := set.Stats(); stats != (CacheStats{}) {
+		t.Fatalf("expected zero-value stats without WithCache, got %+v", stats)
+	}
+}
+
+func TestWithCacheZeroOrNegativeSizeDisablesCache(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		set, err := NewMatcherSet([]string{"spiffe://prod/db/**"}, WithCache(size))
+		if err != nil {
+			t.Fatalf("NewMatcherSet: %v", err)
+		}
+
+		if _, ok := set.Match("spiffe://prod/db/instance1"); !ok {
+			t.Fatalf("expected match")
+		}
+
+		if stats := set.Stats(); stats != (CacheStats{}) {
+			t.Fatalf("WithCache(%d): expected the cache to be disabled, got stats %+v", size, stats)
+		}
+	}
+}
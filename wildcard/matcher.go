@@ -33,6 +33,13 @@
 // (2) A double '**' wildcard will match anything, including the separator
 // rune. It may only occur at the end of a pattern, after a separator.
 //
+// Each of the two also has a named form. A named wildcard '{name}' behaves
+// like '*', but additionally binds the
+// matched segment to "name" so it can be recovered from the Match returned
+// by MatchURI. A named wildcard '{name...}' behaves like '**', binding the
+// entire matched tail to "name"; like '**', it may only occur at the end of
+// a pattern.
+//
 // Furthermore, the matcher will consider the separator optional if it occurs
 // at the end of a string. This means that, for example, the strings
 // "test://foo/bar" and "test://foo/bar/" are treated as equivalent.
@@ -42,6 +49,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -59,17 +67,170 @@ var (
 	errRegexpCompile         = errors.New("unable to compile generated regex (internal bug)")
 	errInvalidPrefix         = errors.New("SPIFFE prefix invalid)")
 	errInvalidSegment        = errors.New("Invalid SPIFFE segment (empty)")
+	errInvalidName           = errors.New("named wildcard '{name}' must have a non-empty name")
+	errDuplicateName         = errors.New("named wildcard name appears more than once in pattern")
+	errTailNotAtEnd          = errors.New("named wildcard '{name...}' can only appear at end of pattern")
 )
 
+// ParseError reports why a pattern failed to compile, including where in
+// the pattern the problem was found.
+type ParseError struct {
+	Pattern string // the full pattern that failed to compile
+	Offset  int    // rune offset into Pattern where the problem was found
+	Segment int    // index of the offending segment, or -1 if not segment-specific
+	Msg     string // human-readable description of the problem
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("at offset %d: %s", e.Offset, e.Msg)
+}
+
+func newParseError(pattern string, offset, segment int, msg string) *ParseError {
+	return &ParseError{Pattern: pattern, Offset: offset, Segment: segment, Msg: msg}
+}
+
+// runeOffset converts a byte index into pattern to a rune offset.
+func runeOffset(pattern string, byteIdx int) int {
+	return utf8.RuneCountInString(pattern[:byteIdx])
+}
+
 // Matcher represents a compiled pattern that can be matched against a string.
 type Matcher interface {
 	// Matches checks if the given input matches the compiled pattern.
 	Matches(string) bool
+	// MatchURI checks if the given input matches the compiled pattern. On a
+	// successful match it also returns a Match exposing any named wildcard
+	// bindings and the tail captured by a trailing "**" or "{name...}"
+	// wildcard.
+	MatchURI(input string) (Match, bool)
 	GetSegments() []string
+	// HasPrefix reports whether some URI whose segments begin with prefix's
+	// segments could possibly match this pattern. Callers building trees of
+	// hierarchical policy can use this to prune a whole subtree without
+	// doing a full match.
+	HasPrefix(prefix string) bool
+}
+
+// Match is the result of a successful MatchURI call. It carries the values
+// bound to any named wildcards in the pattern, as well as the unmatched
+// suffix captured by a trailing wildcard.
+type Match interface {
+	// Get returns the value bound to the named wildcard "name", or "" if
+	// the pattern did not declare a wildcard with that name.
+	Get(name string) string
+	// Tail returns the suffix captured by a trailing "**" or "{name...}"
+	// wildcard, or "" if the pattern has no trailing wildcard.
+	Tail() string
+}
+
+type match struct {
+	names map[string]string
+	tail  string
+}
+
+func (m match) Get(name string) string { return m.names[name] }
+func (m match) Tail() string           { return m.tail }
+
+// segmentKind classifies a single segment of a compiled pattern.
+type segmentKind int
+
+const (
+	segLiteral segmentKind = iota
+	segStar
+	segDoubleStar
+	segNamed
+	segNamedTail
+)
+
+// classifySegment determines the kind of a single pattern segment and, for
+// named wildcards, extracts the bound name.
+func classifySegment(segment string) (segmentKind, string) {
+	if segment == "*" {
+		return segStar, ""
+	}
+	if segment == "**" {
+		return segDoubleStar, ""
+	}
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		name := segment[1 : len(segment)-1]
+		if strings.HasSuffix(name, "...") {
+			return segNamedTail, strings.TrimSuffix(name, "...")
+		}
+		return segNamed, name
+	}
+	return segLiteral, ""
+}
+
+// matchKind classifies an entire compiled pattern, borrowed from the scheme
+// used by Docker's PatternMatcher, so that Matches can dispatch to a cheap
+// comparison instead of always walking the segment loop.
+type matchKind int
+
+const (
+	// exactMatch patterns contain no wildcards at all.
+	exactMatch matchKind = iota
+	// prefixMatch patterns are a run of literal segments followed by a
+	// trailing "**".
+	prefixMatch
+	// suffixMatch patterns are a leading "*" followed by a run of literal
+	// segments.
+	suffixMatch
+	// generalMatch is anything else, and falls through to the segment loop.
+	generalMatch
+)
+
+// classifyMatchKind inspects a compiled pattern's segment kinds and picks the
+// cheapest matchKind that still describes it correctly.
+func classifyMatchKind(kinds []segmentKind) matchKind {
+	allLiteral := true
+	for _, k := range kinds {
+		if k != segLiteral {
+			allLiteral = false
+			break
+		}
+	}
+	if allLiteral {
+		return exactMatch
+	}
+
+	if kinds[len(kinds)-1] == segDoubleStar {
+		literalPrefix := true
+		for _, k := range kinds[:len(kinds)-1] {
+			if k != segLiteral {
+				literalPrefix = false
+				break
+			}
+		}
+		if literalPrefix {
+			return prefixMatch
+		}
+	}
+
+	if kinds[0] == segStar {
+		literalSuffix := true
+		for _, k := range kinds[1:] {
+			if k != segLiteral {
+				literalSuffix = false
+				break
+			}
+		}
+		if literalSuffix {
+			return suffixMatch
+		}
+	}
+
+	return generalMatch
 }
 
 type splitMatcher struct {
 	segments []string
+	kinds    []segmentKind
+	names    []string
+
+	kind          matchKind
+	literalExact  string
+	literalPrefix string
+	literalSuffix string
 }
 
 // Compile creates a new Matcher given a pattern, using '/' as the separator.
@@ -123,40 +284,88 @@ func SuffixCheck(pattern string) {
 	}
 }
 
-// CompileWithSeparator creates a new Matcher given a pattern and separator rune.
+// CompileWithSeparator creates a new Matcher given a pattern and separator
+// rune. On a malformed pattern it returns a *ParseError pinpointing the
+// offending rune offset and segment.
 func CompileWithSeparator(pattern string, separator rune) (Matcher, error) {
 
 	if pattern == "" {
-		return nil, errEmptyPattern
+		return nil, newParseError(pattern, 0, -1, errEmptyPattern.Error())
 	}
 
 	if !PrefixCheck(pattern) {
-		return nil, errInvalidPrefix
+		return nil, newParseError(pattern, 0, -1, errInvalidPrefix.Error())
 	}
 
 	if InnerDoubleStar(pattern) {
-		return nil, errInvalidDoubleWildcard
+		offset := runeOffset(pattern, strings.Index(pattern, "**"))
+		return nil, newParseError(pattern, offset, -1, errInvalidDoubleWildcard.Error())
 	}
 
 	segments := GetSegmentsFromURI(pattern, defaultSeparator)
+	kinds := make([]segmentKind, len(segments))
+	names := make([]string, len(segments))
+	seenNames := map[string]bool{}
+
+	// offsets[i] is the rune offset of segments[i] within pattern, used to
+	// give parse errors pattern context.
+	offsets := make([]int, len(segments))
+	offset := utf8.RuneCountInString("spiffe://")
+	for i, seg := range segments {
+		offsets[i] = offset
+		offset += utf8.RuneCountInString(seg) + 1 // +1 for the separator
+	}
+
 	// Check for malformed URI
 	for i, _ := range segments {
 		// "**" Embedded in a segment
 		if len(segments[i]) > 2 && strings.Contains(segments[i], "**") {
-			return nil, errInvalidDoubleWildcard
+			return nil, newParseError(pattern, offsets[i], i, errInvalidDoubleWildcard.Error())
 			// "*" Embedded in a segment - other than "**"
 		} else if len(segments[i]) > 1 && segments[i] != "**" && strings.Contains(segments[i], "*") {
-			return nil, errInvalidWildcard
+			return nil, newParseError(pattern, offsets[i], i, errInvalidWildcard.Error())
 		}
 		// Empty segment, e.g.: "//"
 		if len(segments[i]) == 0 {
-			return nil, errInvalidSegment
+			return nil, newParseError(pattern, offsets[i], i, errInvalidSegment.Error())
+		}
+
+		kind, name := classifySegment(segments[i])
+		if kind == segNamed || kind == segNamedTail {
+			if name == "" {
+				return nil, newParseError(pattern, offsets[i], i, errInvalidName.Error())
+			}
+			if seenNames[name] {
+				return nil, newParseError(pattern, offsets[i], i, errDuplicateName.Error())
+			}
+			if kind == segNamedTail && i != len(segments)-1 {
+				return nil, newParseError(pattern, offsets[i], i, errTailNotAtEnd.Error())
+			}
+			seenNames[name] = true
 		}
+		kinds[i] = kind
+		names[i] = name
 	}
 
-	return splitMatcher{
+	kind := classifyMatchKind(kinds)
+	m := splitMatcher{
 		segments: segments,
-	}, nil
+		kinds:    kinds,
+		names:    names,
+		kind:     kind,
+	}
+	switch kind {
+	case exactMatch:
+		m.literalExact = "spiffe://" + strings.Join(segments, "/")
+	case prefixMatch:
+		m.literalPrefix = "spiffe://" + strings.Join(segments[:len(segments)-1], "/")
+	case suffixMatch:
+		if len(segments) > 1 {
+			m.literalSuffix = "/" + strings.Join(segments[1:], "/")
+		}
+	}
+
+	return m, nil
 }
 
 func ParseURIWithSeparator(uri string, separator rune) (Matcher, error) {
@@ -199,21 +408,115 @@ func GetSegmentsFromURI(acl string, separator rune) []string {
 
 // Matches checks if the given input matches the compiled pattern.
 func (acl splitMatcher) Matches(input string) bool {
-	//return rm.pattern.Match([]byte(input))
-	uriSegments, err := ParseURIWithSeparator(input, defaultSeparator)
+	if !PrefixCheck(input) {
+		return false
+	}
 
-	if err != nil {
+	switch acl.kind {
+	case exactMatch, prefixMatch, suffixMatch:
+		// The slow path (ParseURIWithSeparator, via MatchURI) rejects
+		// inputs with an empty segment, e.g. "spiffe://a//b". The literal
+		// string comparisons below don't see segments, so they need this
+		// check spelled out explicitly to agree with MatchURI.
+		if hasEmptySegment(input) {
+			return false
+		}
+	}
+
+	trimmed := input
+	if n := len(trimmed); n > 0 && trimmed[n-1] == byte(defaultSeparator) {
+		trimmed = trimmed[:n-1]
+	}
+
+	switch acl.kind {
+	case exactMatch:
+		return trimmed == acl.literalExact
+	case prefixMatch:
+		return acl.matchesPrefix(trimmed)
+	case suffixMatch:
+		return acl.matchesSuffix(trimmed)
+	default:
+		_, ok := acl.MatchURI(input)
+		return ok
+	}
+}
+
+// hasEmptySegment reports whether input (already known to start with
+// "spiffe://") splits into any empty segment, e.g. "spiffe://a//b" or a
+// bare "spiffe://" with nothing after the scheme. It scans bytes directly,
+// mirroring GetSegmentsFromURI's trailing-separator handling, rather than
+// calling it: splitting into a []string would allocate on every call,
+// defeating the point of the exactMatch/prefixMatch/suffixMatch fast paths.
+func hasEmptySegment(input string) bool {
+	rest := input[len("spiffe://"):]
+	if len(rest) > 0 && rest[len(rest)-1] == byte(defaultSeparator) {
+		rest = rest[:len(rest)-1]
+	}
+	if len(rest) == 0 {
+		return true
+	}
+	if rest[0] == byte(defaultSeparator) || rest[len(rest)-1] == byte(defaultSeparator) {
+		return true
+	}
+	for i := 0; i < len(rest)-1; i++ {
+		if rest[i] == byte(defaultSeparator) && rest[i+1] == byte(defaultSeparator) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPrefix implements the prefixMatch fast path: the pattern is a run
+// of literal segments followed by a trailing "**", so matching reduces to a
+// literal prefix check with a segment-boundary guard.
+func (acl splitMatcher) matchesPrefix(input string) bool {
+	if len(acl.segments) == 1 {
+		// Pattern is just "**"; any valid SPIFFE URI matches.
+		return true
+	}
+	if !strings.HasPrefix(input, acl.literalPrefix) {
 		return false
 	}
+	rest := input[len(acl.literalPrefix):]
+	return rest == "" || rest[0] == byte(defaultSeparator)
+}
+
+// matchesSuffix implements the suffixMatch fast path: the pattern is a
+// leading "*" followed by a run of literal segments, so matching reduces to
+// a literal suffix check, with the remaining head required to be exactly
+// one non-empty segment.
+func (acl splitMatcher) matchesSuffix(input string) bool {
+	if !strings.HasSuffix(input, acl.literalSuffix) {
+		return false
+	}
+	head := input[:len(input)-len(acl.literalSuffix)]
+	if !strings.HasPrefix(head, "spiffe://") {
+		return false
+	}
+	firstSegment := head[len("spiffe://"):]
+	return firstSegment != "" && !strings.ContainsRune(firstSegment, defaultSeparator)
+}
+
+// MatchURI checks if the given input matches the compiled pattern and, if
+// so, returns a Match carrying any named wildcard bindings and the tail
+// captured by a trailing "**" or "{name...}" wildcard.
+func (acl splitMatcher) MatchURI(input string) (Match, bool) {
+	uriMatcher, err := ParseURIWithSeparator(input, defaultSeparator)
+	if err != nil {
+		return nil, false
+	}
+	uriSegments := uriMatcher.GetSegments()
 
 	if DEBUG {
-		fmt.Println("Comparing: ", strings.Join(uriSegments.GetSegments(), "!"))
-		fmt.Println("	Length: ", len(uriSegments.GetSegments()))
+		fmt.Println("Comparing: ", strings.Join(uriSegments, "!"))
+		fmt.Println("	Length: ", len(uriSegments))
 		fmt.Println("With ACL : ", strings.Join(acl.segments, "!"))
 		fmt.Println("	Length: ", len(acl.segments))
 	}
 
-	minlen := len(uriSegments.GetSegments())
+	names := map[string]string{}
+
+	minlen := len(uriSegments)
 	if len(acl.segments) < minlen {
 		minlen = len(acl.segments)
 	}
@@ -221,47 +524,99 @@ func (acl splitMatcher) Matches(input string) bool {
 	for i := 0; i < minlen; i++ {
 		if DEBUG {
 			fmt.Println("ACL segment: ", acl.segments[i])
-			fmt.Println("URI segment: ", uriSegments.GetSegments()[i])
+			fmt.Println("URI segment: ", uriSegments[i])
 			fmt.Println("")
 		}
-		// Current segment matches
-		if acl.segments[i] == "*" || acl.segments[i] == uriSegments.GetSegments()[i] {
-			if DEBUG {
-				fmt.Println("[+] continue")
-			}
+		switch acl.kinds[i] {
+		case segStar:
+			// Current segment matches any single segment
+			continue
+		case segNamed:
+			names[acl.names[i]] = uriSegments[i]
 			continue
+		case segDoubleStar:
 			// "**" means we are done and the match was successful
-		} else if acl.segments[i] == "**" {
-			if DEBUG {
-				fmt.Println("[+] ** true - end")
-			}
-			return true
-		} else {
-			if DEBUG {
-				fmt.Println("[+] false - end")
+			tail := strings.Join(uriSegments[i:], string(defaultSeparator))
+			return match{names: names, tail: tail}, true
+		case segNamedTail:
+			tail := strings.Join(uriSegments[i:], string(defaultSeparator))
+			names[acl.names[i]] = tail
+			return match{names: names, tail: tail}, true
+		default:
+			if acl.segments[i] != uriSegments[i] {
+				return nil, false
 			}
-			return false
 		}
 	}
 
 	// Standard case: End reached without conflicts
-	if len(uriSegments.GetSegments()) == len(acl.segments) {
-		return true
+	if len(uriSegments) == len(acl.segments) {
+		return match{names: names}, true
 	}
 
-	// Special case: "**" after the URI is done.
+	// Special case: a trailing "**" or "{name...}" after the URI is done.
 	// This must also be the last segment of the ACL.
 	// We assume the ACL to be properly formatted here
 	// And don't need to check this
-	if len(acl.segments) > minlen && acl.segments[minlen] == "**" {
-		return true
+	if len(acl.segments) > minlen {
+		switch acl.kinds[minlen] {
+		case segDoubleStar:
+			return match{names: names}, true
+		case segNamedTail:
+			names[acl.names[minlen]] = ""
+			return match{names: names}, true
+		}
 	}
 
 	// If none of the above have worked, URI and ACL don't match
-	return false
-
+	return nil, false
 }
 
 func (acl splitMatcher) GetSegments() []string {
 	return acl.segments
 }
+
+// HasPrefix reports whether some URI whose segments begin with prefix's
+// segments could possibly match acl. It walks the shared segments,
+// accepting "*"/"{name}" on the pattern side and short-circuiting true as
+// soon as it reaches a "**" or "{name...}", since a trailing wildcard can
+// absorb whatever comes next.
+func (acl splitMatcher) HasPrefix(prefix string) bool {
+	if !PrefixCheck(prefix) {
+		return false
+	}
+	trimmed := prefix
+	if n := len(trimmed); n > 0 && trimmed[n-1] == byte(defaultSeparator) {
+		trimmed = trimmed[:n-1]
+	}
+	if len(trimmed) <= len("spiffe://") {
+		// Bare "spiffe://" prefix: zero segments, so it's a prefix of every
+		// valid SPIFFE URI. GetSegmentsFromURI assumes at least one byte
+		// follows the scheme, so it can't be called here.
+		return true
+	}
+	prefixSegments := GetSegmentsFromURI(trimmed, defaultSeparator)
+
+	n := len(prefixSegments)
+	if n > len(acl.segments) {
+		n = len(acl.segments)
+	}
+
+	for i := 0; i < n; i++ {
+		switch acl.kinds[i] {
+		case segStar, segNamed:
+			continue
+		case segDoubleStar, segNamedTail:
+			return true
+		default:
+			if acl.segments[i] != prefixSegments[i] {
+				return false
+			}
+		}
+	}
+
+	// Every compared segment matched. If the prefix has more segments than
+	// the pattern, and the pattern ran out without a trailing wildcard to
+	// absorb them, no URI beginning with prefix can match.
+	return len(prefixSegments) <= len(acl.segments)
+}
@@ -0,0 +1,126 @@
+/*-
+ * Copyright 2018 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wildcard
+
+import "testing"
+
+func TestMatchURINamedWildcards(t *testing.T) {
+	m, err := Compile("spiffe://prod/{service}/{instance}")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	match, ok := m.MatchURI("spiffe://prod/db/instance1")
+	if !ok {
+		t.Fatalf("expected match")
+	}
+	if got := match.Get("service"); got != "db" {
+		t.Fatalf("Get(service) = %q, want %q", got, "db")
+	}
+	if got := match.Get("instance"); got != "instance1" {
+		t.Fatalf("Get(instance) = %q, want %q", got, "instance1")
+	}
+	if got := match.Tail(); got != "" {
+		t.Fatalf("Tail() = %q, want empty", got)
+	}
+}
+
+func TestMatchURINamedTailWildcard(t *testing.T) {
+	m, err := Compile("spiffe://prod/{path...}")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	match, ok := m.MatchURI("spiffe://prod/db/instance1")
+	if !ok {
+		t.Fatalf("expected match")
+	}
+	if got := match.Tail(); got != "db/instance1" {
+		t.Fatalf("Tail() = %q, want %q", got, "db/instance1")
+	}
+	if got := match.Get("path"); got != "db/instance1" {
+		t.Fatalf("Get(path) = %q, want %q", got, "db/instance1")
+	}
+}
+
+func TestCompileRejectsDuplicateNames(t *testing.T) {
+	_, err := Compile("spiffe://prod/{service}/{service}")
+	if err == nil {
+		t.Fatalf("expected error for duplicate wildcard name")
+	}
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError, got %T", err)
+	}
+	if perr.Msg != errDuplicateName.Error() {
+		t.Fatalf("Msg = %q, want %q", perr.Msg, errDuplicateName.Error())
+	}
+}
+
+func TestCompileRejectsNamedTailNotAtEnd(t *testing.T) {
+	_, err := Compile("spiffe://prod/{path...}/extra")
+	if err == nil {
+		t.Fatalf("expected error for {name...} not at end of pattern")
+	}
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError, got %T", err)
+	}
+	if perr.Msg != errTailNotAtEnd.Error() {
+		t.Fatalf("Msg = %q, want %q", perr.Msg, errTailNotAtEnd.Error())
+	}
+}
+
+func TestMatchesAgreesWithMatchURIOnEmptySegment(t *testing.T) {
+	m, err := Compile("spiffe://a/**")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	const input = "spiffe://a//b"
+	if _, ok := m.MatchURI(input); ok {
+		t.Fatalf("MatchURI(%q) = true, want false (empty segment)", input)
+	}
+	if m.Matches(input) {
+		t.Fatalf("Matches(%q) = true, want false to agree with MatchURI", input)
+	}
+}
+
+func TestHasPrefixBareSchemeMatchesEverything(t *testing.T) {
+	m, err := Compile("spiffe://a/b/**")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	if !m.HasPrefix("spiffe://") {
+		t.Fatalf("HasPrefix(%q) = false, want true (zero segments is a prefix of everything)", "spiffe://")
+	}
+}
+
+func TestMatchesExactAllocationFree(t *testing.T) {
+	m, err := Compile("spiffe://prod/db/instance1")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Matches("spiffe://prod/db/instance1")
+	})
+	if allocs != 0 {
+		t.Fatalf("Matches allocated %v times per call, want 0", allocs)
+	}
+}
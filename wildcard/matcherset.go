@@ -0,0 +1,221 @@
+/*-
+ * Copyright 2018 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wildcard
+
+import "sync"
+
+// MatcherSet indexes a list of compiled patterns in a radix tree keyed by
+// literal path segments, so that checking a URI against many patterns costs
+// roughly O(segments) rather than O(patterns * segments).
+type MatcherSet struct {
+	mu       sync.RWMutex
+	root     *matcherNode
+	patterns []Matcher
+
+	cache *lruCache
+}
+
+// Option configures a MatcherSet at construction time.
+type Option func(*MatcherSet)
+
+// WithCache enables a bounded LRU cache of up to size recent Match results,
+// keyed by input URI. Peer identities on a connection tend to repeat heavily
+// over a process's lifetime, so a small cache eliminates most matching work
+// on steady-state traffic. A size <= 0 disables the cache (leaves it unset)
+// rather than growing it without bound.
+func WithCache(size int) Option {
+	return func(s *MatcherSet) {
+		if size <= 0 {
+			s.cache = nil
+			return
+		}
+		s.cache = newLRUCache(size)
+	}
+}
+
+// matcherNode is one level of the radix tree. Patterns with a literal
+// segment at this depth are indexed by that literal; patterns with a "*" or
+// named single-segment wildcard all share the single star branch; patterns
+// terminating in a "**" or "{name...}" are recorded in tail, since they
+// match regardless of what (if anything) follows at this depth.
+type matcherNode struct {
+	literal map[string]*matcherNode
+	star    *matcherNode
+	here    []Matcher
+	tail    []Matcher
+}
+
+func newMatcherNode() *matcherNode {
+	return &matcherNode{literal: map[string]*matcherNode{}}
+}
+
+// NewMatcherSet compiles the given patterns and indexes them in a radix tree
+// for fast lookup.
+func NewMatcherSet(patterns []string, opts ...Option) (*MatcherSet, error) {
+	set := &MatcherSet{root: newMatcherNode()}
+	for _, opt := range opts {
+		opt(set)
+	}
+
+	if err := set.rebuild(patterns); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Rebuild replaces the set's patterns in place, so callers holding a
+// reference to the set see the new patterns on their next lookup. Any
+// cached decisions from the previous pattern list are invalidated.
+func (s *MatcherSet) Rebuild(patterns []string) error {
+	return s.rebuild(patterns)
+}
+
+func (s *MatcherSet) rebuild(patterns []string) error {
+	matchers, err := CompileList(patterns)
+	if err != nil {
+		return err
+	}
+
+	root := newMatcherNode()
+	tmp := &MatcherSet{root: root}
+	for _, m := range matchers {
+		tmp.insert(m)
+	}
+
+	s.mu.Lock()
+	s.root = tmp.root
+	s.patterns = matchers
+	s.mu.Unlock()
+
+	if s.cache != nil {
+		s.cache.reset()
+	}
+	return nil
+}
+
+// insert walks the pattern's segments, growing the tree as needed, and
+// records the pattern at the node corresponding to where it stops matching.
+func (s *MatcherSet) insert(m Matcher) {
+	node := s.root
+	segments := m.GetSegments()
+	for i, seg := range segments {
+		kind, _ := classifySegment(seg)
+
+		if kind == segDoubleStar || kind == segNamedTail {
+			node.tail = append(node.tail, m)
+			return
+		}
+
+		if kind == segStar || kind == segNamed {
+			if node.star == nil {
+				node.star = newMatcherNode()
+			}
+			node = node.star
+		} else {
+			child, ok := node.literal[seg]
+			if !ok {
+				child = newMatcherNode()
+				node.literal[seg] = child
+			}
+			node = child
+		}
+
+		if i == len(segments)-1 {
+			node.here = append(node.here, m)
+		}
+	}
+}
+
+// Match returns a pattern in the set that matches the given URI. When
+// multiple patterns match, which one is returned is unspecified; use
+// MatchAll to see every match. If the set was constructed with WithCache,
+// the decision for this URI is served from cache when possible.
+func (s *MatcherSet) Match(uri string) (Matcher, bool) {
+	if s.cache != nil {
+		if cached, ok := s.cache.get(uri); ok {
+			return cached.m, cached.ok
+		}
+	}
+
+	s.mu.RLock()
+	root := s.root
+	s.mu.RUnlock()
+
+	all := s.matchAllLocked(uri)
+	var result cachedMatch
+	if len(all) > 0 {
+		result = cachedMatch{m: all[0], ok: true}
+	}
+
+	if s.cache != nil {
+		// Skip caching if a Rebuild swapped the tree meanwhile, so a decision
+		// from the old pattern list can't outlive the rebuild's cache reset.
+		s.mu.RLock()
+		if s.root == root {
+			s.cache.put(uri, result)
+		}
+		s.mu.RUnlock()
+	}
+	return result.m, result.ok
+}
+
+// MatchAll returns every pattern in the set that matches the given URI.
+// MatchAll is not served from the cache, since it is not the hot path the
+// cache targets.
+func (s *MatcherSet) MatchAll(uri string) []Matcher {
+	return s.matchAllLocked(uri)
+}
+
+func (s *MatcherSet) matchAllLocked(uri string) []Matcher {
+	u, err := ParseURIWithSeparator(uri, defaultSeparator)
+	if err != nil {
+		return nil
+	}
+	segments := u.GetSegments()
+
+	s.mu.RLock()
+	root := s.root
+	s.mu.RUnlock()
+
+	var results []Matcher
+	var walk func(node *matcherNode, i int)
+	walk = func(node *matcherNode, i int) {
+		if node == nil {
+			return
+		}
+		results = append(results, node.tail...)
+		if i == len(segments) {
+			results = append(results, node.here...)
+			return
+		}
+		if child, ok := node.literal[segments[i]]; ok {
+			walk(child, i+1)
+		}
+		walk(node.star, i+1)
+	}
+	walk(root, 0)
+	return results
+}
+
+// Stats reports cache hit/miss counters for the set. It returns the zero
+// value if the set was constructed without WithCache.
+func (s *MatcherSet) Stats() CacheStats {
+	if s.cache == nil {
+		return CacheStats{}
+	}
+	return s.cache.stats()
+}
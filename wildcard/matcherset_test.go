@@ -0,0 +1,77 @@
+/*-
+ * Copyright 2018 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wildcard
+
+import "testing"
+
+func TestMatcherSetLiteralBranch(t *testing.T) {
+	set, err := NewMatcherSet([]string{"spiffe://prod/db/instance1"})
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	if _, ok := set.Match("spiffe://prod/db/instance1"); !ok {
+		t.Fatalf("expected literal match")
+	}
+	if _, ok := set.Match("spiffe://prod/db/instance2"); ok {
+		t.Fatalf("expected no match for a different literal")
+	}
+}
+
+func TestMatcherSetStarBranch(t *testing.T) {
+	set, err := NewMatcherSet([]string{"spiffe://prod/db/*"})
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	if _, ok := set.Match("spiffe://prod/db/instance1"); !ok {
+		t.Fatalf("expected star branch to match a single segment")
+	}
+	if _, ok := set.Match("spiffe://prod/db/instance1/extra"); ok {
+		t.Fatalf("expected star branch not to match more than one segment")
+	}
+}
+
+func TestMatcherSetTailBranch(t *testing.T) {
+	set, err := NewMatcherSet([]string{"spiffe://prod/db/**"})
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	if _, ok := set.Match("spiffe://prod/db/instance1/shard0"); !ok {
+		t.Fatalf("expected tail branch to match an arbitrary suffix")
+	}
+	if _, ok := set.Match("spiffe://prod/web/instance1"); ok {
+		t.Fatalf("expected no match outside the literal prefix leading to the tail")
+	}
+}
+
+func TestMatcherSetMatchAllAcrossBranches(t *testing.T) {
+	set, err := NewMatcherSet([]string{
+		"spiffe://prod/db/instance1",
+		"spiffe://prod/db/*",
+		"spiffe://prod/**",
+	})
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	all := set.MatchAll("spiffe://prod/db/instance1")
+	if len(all) != 3 {
+		t.Fatalf("expected all three patterns (literal, star, tail) to match, got %d", len(all))
+	}
+}
@@ -0,0 +1,101 @@
+/*-
+ * Copyright 2018 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wildcard
+
+import "testing"
+
+func TestCompileWithSeparatorParseErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		pattern string
+		offset  int
+		segment int
+		msg     string
+	}{
+		{
+			name:    "empty pattern",
+			pattern: "",
+			offset:  0,
+			segment: -1,
+			msg:     errEmptyPattern.Error(),
+		},
+		{
+			name:    "missing prefix",
+			pattern: "foo/bar",
+			offset:  0,
+			segment: -1,
+			msg:     errInvalidPrefix.Error(),
+		},
+		{
+			name:    "double star not at end",
+			pattern: "spiffe://a/**/b",
+			offset:  11,
+			segment: -1,
+			msg:     errInvalidDoubleWildcard.Error(),
+		},
+		{
+			name:    "star embedded in segment",
+			pattern: "spiffe://a/b*c",
+			offset:  11,
+			segment: 1,
+			msg:     errInvalidWildcard.Error(),
+		},
+		{
+			name:    "empty segment",
+			pattern: "spiffe://a//b",
+			offset:  11,
+			segment: 1,
+			msg:     errInvalidSegment.Error(),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CompileWithSeparator(tc.pattern, defaultSeparator)
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("expected *ParseError, got %T", err)
+			}
+			if perr.Pattern != tc.pattern {
+				t.Fatalf("Pattern = %q, want %q", perr.Pattern, tc.pattern)
+			}
+			if perr.Offset != tc.offset {
+				t.Fatalf("Offset = %d, want %d", perr.Offset, tc.offset)
+			}
+			if perr.Segment != tc.segment {
+				t.Fatalf("Segment = %d, want %d", perr.Segment, tc.segment)
+			}
+			if perr.Msg != tc.msg {
+				t.Fatalf("Msg = %q, want %q", perr.Msg, tc.msg)
+			}
+		})
+	}
+}
+
+func TestParseErrorErrorIncludesOffset(t *testing.T) {
+	_, err := CompileWithSeparator("spiffe://a/**/b", defaultSeparator)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	const want = "at offset 11: wildcard '**' can only appear at end of pattern"
+	if got := err.Error(); got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+/*-
+ * Copyright 2018 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wildcard
+
+import (
+	"sort"
+	"strings"
+)
+
+// specificityRank orders segment kinds from least to most specific:
+// "**"/"{name...}" < "*"/"{name}" < a literal segment.
+func specificityRank(kind segmentKind) int {
+	switch kind {
+	case segLiteral:
+		return 2
+	case segStar, segNamed:
+		return 1
+	default: // segDoubleStar, segNamedTail
+		return 0
+	}
+}
+
+// compareSpecificity compares a and b segment by segment and reports
+// whether a dominates (1), b dominates (-1), or neither dominates the other
+// (0), following the more-specific-wins rule: a literal segment beats
+// "*"/"{name}", which beats "**"/"{name...}". Domination requires agreement
+// at every compared position: if one position favors a and another favors
+// b, the patterns are an ambiguous pair rather than one being "more
+// specific".
+func compareSpecificity(a, b Matcher) int {
+	as, bs := a.GetSegments(), b.GetSegments()
+	n := len(as)
+	if len(bs) < n {
+		n = len(bs)
+	}
+
+	result := 0
+	for i := 0; i < n; i++ {
+		ak, _ := classifySegment(as[i])
+		bk, _ := classifySegment(bs[i])
+		ar, br := specificityRank(ak), specificityRank(bk)
+		if ar == br {
+			continue
+		}
+		dir := -1
+		if ar > br {
+			dir = 1
+		}
+		if result != 0 && result != dir {
+			return 0
+		}
+		result = dir
+	}
+
+	if len(as) != len(bs) {
+		// A longer pattern isn't automatically more specific: if its extra
+		// length comes from a trailing "**"/"{name...}" absorbing zero
+		// segments here, the shorter, exact-length pattern wins instead
+		// (literal > "**", same as any other position).
+		var dir int
+		if len(as) > len(bs) {
+			if k, _ := classifySegment(as[len(bs)]); k == segDoubleStar || k == segNamedTail {
+				dir = -1
+			} else {
+				dir = 1
+			}
+		} else {
+			if k, _ := classifySegment(bs[len(as)]); k == segDoubleStar || k == segNamedTail {
+				dir = 1
+			} else {
+				dir = -1
+			}
+		}
+		if result != 0 && result != dir {
+			return 0
+		}
+		result = dir
+	}
+
+	return result
+}
+
+// couldOverlap reports whether some URI could match both a and b, so that
+// Conflicts doesn't flag pattern pairs that can never actually compete for
+// the same request.
+func couldOverlap(a, b Matcher) bool {
+	as, bs := a.GetSegments(), b.GetSegments()
+	n := len(as)
+	if len(bs) < n {
+		n = len(bs)
+	}
+
+	for i := 0; i < n; i++ {
+		ak, _ := classifySegment(as[i])
+		bk, _ := classifySegment(bs[i])
+		if ak == segDoubleStar || ak == segNamedTail || bk == segDoubleStar || bk == segNamedTail {
+			// A trailing wildcard can absorb any remaining difference.
+			return true
+		}
+		if ak == segLiteral && bk == segLiteral && as[i] != bs[i] {
+			return false
+		}
+	}
+
+	// Reached the end of the shorter pattern without hitting a tail
+	// wildcard. The patterns can still overlap if the longer one's very
+	// next segment is a trailing "**"/"{name...}", since that can absorb
+	// zero segments and terminate exactly where the shorter one does.
+	if len(as) == len(bs) {
+		return true
+	}
+	longer := bs
+	if len(as) > len(bs) {
+		longer = as
+	}
+	k, _ := classifySegment(longer[n])
+	return k == segDoubleStar || k == segNamedTail
+}
+
+// patternString rebuilds the "spiffe://..." pattern text of a compiled
+// Matcher from its segments. A trailing separator in the original pattern
+// is not reproduced.
+func patternString(m Matcher) string {
+	return "spiffe://" + strings.Join(m.GetSegments(), "/")
+}
+
+// Explain returns every pattern in the set that matches uri, ordered from
+// most specific to least specific (see compareSpecificity). Use this, or
+// MostSpecific, to deterministically pick a policy when more than one
+// pattern matches.
+func (s *MatcherSet) Explain(uri string) []Matcher {
+	matches := s.matchAllLocked(uri)
+	sort.SliceStable(matches, func(i, j int) bool {
+		return compareSpecificity(matches[i], matches[j]) > 0
+	})
+	return matches
+}
+
+// MostSpecific returns the most specific pattern in the set that matches
+// uri, using the same precedence rule as Explain and Conflicts.
+func (s *MatcherSet) MostSpecific(uri string) (Matcher, bool) {
+	explained := s.Explain(uri)
+	if len(explained) == 0 {
+		return nil, false
+	}
+	return explained[0], true
+}
+
+// Conflicts reports pairs of patterns in the set that could match a common
+// URI but for which neither is strictly more specific than the other, i.e.
+// an ambiguous precedence. Pairs are returned as pattern strings (see
+// patternString), in the order the patterns were compiled.
+func (s *MatcherSet) Conflicts() [][2]string {
+	s.mu.RLock()
+	patterns := s.patterns
+	s.mu.RUnlock()
+
+	var conflicts [][2]string
+	for i := 0; i < len(patterns); i++ {
+		for j := i + 1; j < len(patterns); j++ {
+			a, b := patterns[i], patterns[j]
+			if !couldOverlap(a, b) {
+				continue
+			}
+			if compareSpecificity(a, b) == 0 {
+				conflicts = append(conflicts, [2]string{patternString(a), patternString(b)})
+			}
+		}
+	}
+	return conflicts
+}
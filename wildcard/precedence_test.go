@@ -0,0 +1,81 @@
+/*-
+ * Copyright 2018 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wildcard
+
+import "testing"
+
+func TestConflictsFlagsSiblingWildcards(t *testing.T) {
+	set, err := NewMatcherSet([]string{"spiffe://x/*/z", "spiffe://x/y/*"})
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	all := set.MatchAll("spiffe://x/y/z")
+	if len(all) != 2 {
+		t.Fatalf("expected both patterns to match spiffe://x/y/z, got %d", len(all))
+	}
+
+	conflicts := set.Conflicts()
+	if len(conflicts) != 1 {
+		t.Fatalf("expected one conflict between the sibling wildcards, got %v", conflicts)
+	}
+}
+
+func TestConflictsIgnoresClearPrecedence(t *testing.T) {
+	set, err := NewMatcherSet([]string{"spiffe://x/foo/*", "spiffe://x/**"})
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	if conflicts := set.Conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts, since spiffe://x/foo/* strictly dominates spiffe://x/**, got %v", conflicts)
+	}
+
+	explained := set.Explain("spiffe://x/foo/bar")
+	if len(explained) != 2 {
+		t.Fatalf("expected both patterns to match, got %d", len(explained))
+	}
+	if got := patternString(explained[0]); got != "spiffe://x/foo/*" {
+		t.Fatalf("expected the more specific pattern first, got %q", got)
+	}
+
+	m, ok := set.MostSpecific("spiffe://x/foo/bar")
+	if !ok || patternString(m) != "spiffe://x/foo/*" {
+		t.Fatalf("MostSpecific = %v, %v; want spiffe://x/foo/*", m, ok)
+	}
+}
+
+func TestConflictsExactLiteralBeatsOwnTrailingDoubleStar(t *testing.T) {
+	set, err := NewMatcherSet([]string{"spiffe://x/y", "spiffe://x/y/**"})
+	if err != nil {
+		t.Fatalf("NewMatcherSet: %v", err)
+	}
+
+	all := set.MatchAll("spiffe://x/y")
+	if len(all) != 2 {
+		t.Fatalf("expected both patterns to match spiffe://x/y, got %d", len(all))
+	}
+
+	if conflicts := set.Conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts, since spiffe://x/y strictly dominates spiffe://x/y/**, got %v", conflicts)
+	}
+
+	m, ok := set.MostSpecific("spiffe://x/y")
+	if !ok || patternString(m) != "spiffe://x/y" {
+		t.Fatalf("MostSpecific = %v, %v; want spiffe://x/y", m, ok)
+	}
+}